@@ -43,13 +43,72 @@ import (
 	"go/types"
 )
 
-func typeString(pkg *types.Package, typ types.Type) (string, error) {
+// TypeString returns the string representation of typ.
+// The Qualifier controls the printing of package-level objects, and may
+// be nil. See RelativeTo and PackagePath for ready-made Qualifiers.
+func TypeString(typ types.Type, qf types.Qualifier) (string, error) {
 	var buf bytes.Buffer
-	err := writeType(&buf, pkg, typ, make([]types.Type, 0, 8))
+	err := writeType(&buf, qf, typ, make([]types.Type, 0, 8))
 	return buf.String(), err
 }
 
-func writeType(buf *bytes.Buffer, pkg *types.Package, typ types.Type, visited []types.Type) error {
+// RelativeTo returns a Qualifier that qualifies members of all packages
+// other than pkg by their package name; members of pkg are unqualified.
+func RelativeTo(pkg *types.Package) types.Qualifier {
+	if pkg == nil {
+		return nil
+	}
+	return func(other *types.Package) string {
+		if pkg == other {
+			return "" // same package; unqualified
+		}
+		return other.Name()
+	}
+}
+
+// PackagePath returns a Qualifier that qualifies every member by its
+// package's full import path rather than its (possibly ambiguous or
+// aliased) package name. This is the qualifier code generators want:
+// the caller can then rewrite "path".Name into whatever local import
+// alias the destination file actually uses.
+func PackagePath() types.Qualifier {
+	return func(pkg *types.Package) string {
+		return pkg.Path()
+	}
+}
+
+// TypeStringWithImports is like TypeString, qualifying names relative to
+// pkg, but additionally returns the distinct packages other than pkg
+// referenced while rendering typ. Callers that fill in or generate code in a different
+// file can use this to reconcile imports (adding missing ones, resolving
+// alias collisions) instead of assuming the destination already imports
+// every package the type mentions.
+func TypeStringWithImports(pkg *types.Package, typ types.Type) (string, []*types.Package, error) {
+	var imports []*types.Package
+	seen := make(map[*types.Package]bool)
+	qf := func(other *types.Package) string {
+		if other != pkg && !seen[other] {
+			seen[other] = true
+			imports = append(imports, other)
+		}
+		return RelativeTo(pkg)(other)
+	}
+	s, err := TypeString(typ, qf)
+	return s, imports, err
+}
+
+// writeName writes the (possibly qualified) name of obj to buf.
+func writeName(buf *bytes.Buffer, qf types.Qualifier, obj types.Object) {
+	if pkg := obj.Pkg(); pkg != nil && qf != nil {
+		if s := qf(pkg); s != "" {
+			buf.WriteString(s)
+			buf.WriteByte('.')
+		}
+	}
+	buf.WriteString(obj.Name())
+}
+
+func writeType(buf *bytes.Buffer, qf types.Qualifier, typ types.Type, visited []types.Type) error {
 	// Theoretically, this is a quadratic lookup algorithm, but in
 	// practice deeply nested composite types with unnamed component
 	// types are uncommon. This code is likely more efficient than
@@ -72,18 +131,25 @@ func writeType(buf *bytes.Buffer, pkg *types.Package, typ types.Type, visited []
 			return errors.New("TODO")
 		}
 		if t.Kind() == types.UnsafePointer {
-			buf.WriteString("unsafe.")
+			name := types.Unsafe.Name()
+			if qf != nil {
+				if s := qf(types.Unsafe); s != "" {
+					name = s
+				}
+			}
+			buf.WriteString(name)
+			buf.WriteByte('.')
 		}
 		buf.WriteString(t.Name())
 		return nil
 
 	case *types.Array:
 		fmt.Fprintf(buf, "[%d]", t.Len())
-		return writeType(buf, pkg, t.Elem(), visited)
+		return writeType(buf, qf, t.Elem(), visited)
 
 	case *types.Slice:
 		buf.WriteString("[]")
-		return writeType(buf, pkg, t.Elem(), visited)
+		return writeType(buf, qf, t.Elem(), visited)
 
 	case *types.Struct:
 		buf.WriteString("struct{")
@@ -96,7 +162,7 @@ func writeType(buf *bytes.Buffer, pkg *types.Package, typ types.Type, visited []
 				buf.WriteString(f.Name())
 				buf.WriteByte(' ')
 			}
-			if err := writeType(buf, pkg, f.Type(), visited); err != nil {
+			if err := writeType(buf, qf, f.Type(), visited); err != nil {
 				return err
 			}
 			if tag := t.Tag(i); tag != "" {
@@ -108,16 +174,51 @@ func writeType(buf *bytes.Buffer, pkg *types.Package, typ types.Type, visited []
 
 	case *types.Pointer:
 		buf.WriteByte('*')
-		return writeType(buf, pkg, t.Elem(), visited)
+		return writeType(buf, qf, t.Elem(), visited)
 
 	case *types.Tuple:
-		return writeTuple(buf, pkg, t, false, visited)
+		return writeTuple(buf, qf, t, false, visited)
 
 	case *types.Signature:
 		buf.WriteString("func")
-		return writeSignature(buf, pkg, t, visited)
+		return writeSignature(buf, qf, t, visited)
+
+	case *types.TypeParam:
+		// Type parameters are never package-qualified: "pkg.T" is not
+		// valid syntax for referring to one, unlike a *types.Named.
+		buf.WriteString(t.Obj().Name())
+		return nil
+
+	case *types.Union:
+		for i := 0; i < t.Len(); i++ {
+			if i > 0 {
+				buf.WriteByte('|')
+			}
+			term := t.Term(i)
+			if term.Tilde() {
+				buf.WriteByte('~')
+			}
+			if err := writeType(buf, qf, term.Type(), visited); err != nil {
+				return err
+			}
+		}
+		return nil
 
 	case *types.Interface:
+		// The predeclared "any" is an alias for interface{}; print it by
+		// name rather than as an empty interface literal.
+		if t == types.Universe.Lookup("any").Type() {
+			buf.WriteString("any")
+			return nil
+		}
+		// A type parameter constraint written as a bare union or type,
+		// e.g. "~int | ~float64", is wrapped by go/types in an implicit
+		// interface with that one embedded type set and no methods.
+		// Unwrap it so it prints as the constraint literal instead of
+		// "interface{~int|~float64}".
+		if t.IsImplicit() && t.NumEmbeddeds() == 1 {
+			return writeType(buf, qf, t.EmbeddedType(0), visited)
+		}
 		// We write the source-level methods and embedded types rather
 		// than the actual method set since resolved method signatures
 		// may have non-printable cycles if parameters have anonymous
@@ -137,7 +238,7 @@ func writeType(buf *bytes.Buffer, pkg *types.Package, typ types.Type, visited []
 				buf.WriteString("; ")
 			}
 			buf.WriteString(m.Name())
-			if err := writeSignature(buf, pkg, m.Type().(*types.Signature), visited); err != nil {
+			if err := writeSignature(buf, qf, m.Type().(*types.Signature), visited); err != nil {
 				return err
 			}
 		}
@@ -145,7 +246,7 @@ func writeType(buf *bytes.Buffer, pkg *types.Package, typ types.Type, visited []
 			if i > 0 || t.NumMethods() > 0 {
 				buf.WriteString("; ")
 			}
-			if err := writeType(buf, pkg, t.Embedded(i), visited); err != nil {
+			if err := writeType(buf, qf, t.EmbeddedType(i), visited); err != nil {
 				return err
 			}
 		}
@@ -154,11 +255,11 @@ func writeType(buf *bytes.Buffer, pkg *types.Package, typ types.Type, visited []
 
 	case *types.Map:
 		buf.WriteString("map[")
-		if err := writeType(buf, pkg, t.Key(), visited); err != nil {
+		if err := writeType(buf, qf, t.Key(), visited); err != nil {
 			return err
 		}
 		buf.WriteByte(']')
-		return writeType(buf, pkg, t.Elem(), visited)
+		return writeType(buf, qf, t.Elem(), visited)
 
 	case *types.Chan:
 		var s string
@@ -181,7 +282,7 @@ func writeType(buf *bytes.Buffer, pkg *types.Package, typ types.Type, visited []
 		if parens {
 			buf.WriteByte('(')
 		}
-		if err := writeType(buf, pkg, t.Elem(), visited); err != nil {
+		if err := writeType(buf, qf, t.Elem(), visited); err != nil {
 			return err
 		}
 		if parens {
@@ -190,10 +291,18 @@ func writeType(buf *bytes.Buffer, pkg *types.Package, typ types.Type, visited []
 		return nil
 
 	case *types.Named:
-		if isImported(pkg, t) && t.Obj().Pkg() != nil {
-			buf.WriteString(fmt.Sprintf("%s.%s", t.Obj().Pkg().Name(), t.Obj().Name()))
-		} else {
-			buf.WriteString(t.Obj().Name())
+		writeName(buf, qf, t.Obj())
+		if args := t.TypeArgs(); args != nil && args.Len() > 0 {
+			buf.WriteByte('[')
+			for i := 0; i < args.Len(); i++ {
+				if i > 0 {
+					buf.WriteString(", ")
+				}
+				if err := writeType(buf, qf, args.At(i), visited); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
 		}
 		return nil
 
@@ -204,7 +313,7 @@ func writeType(buf *bytes.Buffer, pkg *types.Package, typ types.Type, visited []
 	}
 }
 
-func writeTuple(buf *bytes.Buffer, pkg *types.Package, tup *types.Tuple, variadic bool, visited []types.Type) error {
+func writeTuple(buf *bytes.Buffer, qf types.Qualifier, tup *types.Tuple, variadic bool, visited []types.Type) error {
 	buf.WriteByte('(')
 	if tup != nil {
 		for i := 0; i < tup.Len(); i++ {
@@ -227,20 +336,36 @@ func writeTuple(buf *bytes.Buffer, pkg *types.Package, tup *types.Tuple, variadi
 					if t, ok := typ.Underlying().(*types.Basic); !ok || t.Kind() != types.String {
 						panic("internal error: string type expected")
 					}
-					writeType(buf, pkg, typ, visited)
+					writeType(buf, qf, typ, visited)
 					buf.WriteString("...")
 					continue
 				}
 			}
-			writeType(buf, pkg, typ, visited)
+			writeType(buf, qf, typ, visited)
 		}
 	}
 	buf.WriteByte(')')
 	return nil
 }
 
-func writeSignature(buf *bytes.Buffer, pkg *types.Package, sig *types.Signature, visited []types.Type) error {
-	writeTuple(buf, pkg, sig.Params(), sig.Variadic(), visited)
+func writeSignature(buf *bytes.Buffer, qf types.Qualifier, sig *types.Signature, visited []types.Type) error {
+	if tparams := sig.TypeParams(); tparams != nil && tparams.Len() > 0 {
+		buf.WriteByte('[')
+		for i := 0; i < tparams.Len(); i++ {
+			if i > 0 {
+				buf.WriteString(", ")
+			}
+			tp := tparams.At(i)
+			buf.WriteString(tp.Obj().Name())
+			buf.WriteByte(' ')
+			if err := writeType(buf, qf, tp.Constraint(), visited); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte(']')
+	}
+
+	writeTuple(buf, qf, sig.Params(), sig.Variadic(), visited)
 
 	n := sig.Results().Len()
 	if n == 0 {
@@ -250,9 +375,9 @@ func writeSignature(buf *bytes.Buffer, pkg *types.Package, sig *types.Signature,
 	buf.WriteByte(' ')
 	if n == 1 && sig.Results().At(0).Name() == "" {
 		// single unnamed result
-		return writeType(buf, pkg, sig.Results().At(0).Type(), visited)
+		return writeType(buf, qf, sig.Results().At(0).Type(), visited)
 	}
 
 	// multiple or named result(s)
-	return writeTuple(buf, pkg, sig.Results(), false, visited)
+	return writeTuple(buf, qf, sig.Results(), false, visited)
 }
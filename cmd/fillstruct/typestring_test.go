@@ -0,0 +1,147 @@
+// Copyright (c) 2017 David R. Jenni. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"go/ast"
+	"go/importer"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"testing"
+)
+
+// check type-checks src as a standalone package named name and returns it.
+func check(t *testing.T, name, src string) *types.Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, name+".go", src, 0)
+	if err != nil {
+		t.Fatalf("parse %s: %v", name, err)
+	}
+	conf := types.Config{Importer: importer.Default()}
+	pkg, err := conf.Check(name, fset, []*ast.File{f}, nil)
+	if err != nil {
+		t.Fatalf("typecheck %s: %v", name, err)
+	}
+	return pkg
+}
+
+func TestTypeStringUnion(t *testing.T) {
+	pkg := check(t, "p", `package p
+func Sum[T any, U ~int | ~float64](x T, y U) U { return y }
+`)
+	sig := pkg.Scope().Lookup("Sum").Type().(*types.Signature)
+
+	got, err := TypeString(sig, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "func[T any, U ~int|~float64](x T, y U) U"
+	if got != want {
+		t.Errorf("TypeString() = %q, want %q", got, want)
+	}
+}
+
+func TestTypeStringNamedInstantiated(t *testing.T) {
+	pkg := check(t, "p", `package p
+type Box[T any] struct{ v T }
+var B Box[int]
+`)
+	typ := pkg.Scope().Lookup("B").Type()
+
+	got, err := TypeString(typ, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Box[int]"
+	if got != want {
+		t.Errorf("TypeString() = %q, want %q", got, want)
+	}
+}
+
+func TestTypeStringTypeParamNotQualified(t *testing.T) {
+	other := check(t, "a", `package a
+type Container[T any] struct{ v T }
+func F[T any]() Container[T] { var c Container[T]; return c }
+`)
+	pkg := types.NewPackage("example.com/p", "p")
+	sig := other.Scope().Lookup("F").Type().(*types.Signature)
+
+	got, err := TypeString(sig, RelativeTo(pkg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "func[T any]() a.Container[T]"
+	if got != want {
+		t.Errorf("TypeString() = %q, want %q", got, want)
+	}
+}
+
+func TestTypeStringRelativeToQualifier(t *testing.T) {
+	other := check(t, "a", `package a
+type T struct{}
+`)
+	named := other.Scope().Lookup("T").Type()
+
+	samePkg, err := TypeString(named, RelativeTo(other))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if samePkg != "T" {
+		t.Errorf("TypeString() relative to own package = %q, want %q", samePkg, "T")
+	}
+
+	pkg := types.NewPackage("example.com/p", "p")
+	otherPkg, err := TypeString(named, RelativeTo(pkg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherPkg != "a.T" {
+		t.Errorf("TypeString() relative to other package = %q, want %q", otherPkg, "a.T")
+	}
+
+	byPath, err := TypeString(named, PackagePath())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if byPath != "a.T" {
+		t.Errorf("TypeString() with PackagePath = %q, want %q", byPath, "a.T")
+	}
+}
+
+func TestTypeStringWithImports(t *testing.T) {
+	other := check(t, "a", `package a
+type T struct{}
+`)
+	named := other.Scope().Lookup("T").Type()
+	pkg := types.NewPackage("example.com/p", "p")
+
+	got, imports, err := TypeStringWithImports(pkg, named)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "a.T" {
+		t.Errorf("TypeStringWithImports() = %q, want %q", got, "a.T")
+	}
+	if len(imports) != 1 || imports[0] != other {
+		t.Errorf("TypeStringWithImports() imports = %v, want [%v]", imports, other)
+	}
+}
+
+func TestTypeStringWithImportsUnsafePointer(t *testing.T) {
+	pkg := types.NewPackage("example.com/p", "p")
+
+	got, imports, err := TypeStringWithImports(pkg, types.Typ[types.UnsafePointer])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != "unsafe.Pointer" {
+		t.Errorf("TypeStringWithImports() = %q, want %q", got, "unsafe.Pointer")
+	}
+	if len(imports) != 1 || imports[0].Path() != "unsafe" {
+		t.Errorf("TypeStringWithImports() imports = %v, want [unsafe]", imports)
+	}
+}